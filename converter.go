@@ -16,19 +16,71 @@ size_t call_iconv(iconv_t ctx, char *in, size_t *size_in, char *out, size_t *siz
 
 */
 import "C"
+import "strings"
 import "syscall"
 import "unsafe"
 
 type Converter struct {
 	context C.iconv_t
 	open    bool
+	options Options
+
+	// pendingReplacement holds the tail of an OnInvalid replacement that
+	// didn't fit into a previous Convert call's output buffer. It is
+	// unconditionally flushed at the start of the next Convert call, before
+	// any new input is looked at, so OnInvalid is never invoked twice for
+	// input it has already been asked about - regardless of whether the
+	// next call is a caller retrying with a bigger buffer or an unrelated
+	// conversion reusing this same (pooled) Converter
+	pendingReplacement []byte
+}
+
+// Options configures optional, non-default behavior of a Converter
+type Options struct {
+	// Translit requests iconv's "//TRANSLIT" behavior on the target
+	// encoding, approximating characters with no exact equivalent instead
+	// of failing with EILSEQ
+	Translit bool
+
+	// Ignore requests iconv's "//IGNORE" behavior on the target encoding,
+	// silently dropping characters that cannot be represented
+	Ignore bool
+
+	// OnInvalid, when set, is called by Convert whenever the underlying
+	// iconv call reports EILSEQ instead of returning the error. bad is the
+	// unconverted remainder of the input starting at the offending byte.
+	// OnInvalid returns the bytes to splice into the output in place of the
+	// invalid sequence and the number of input bytes to skip over it
+	OnInvalid func(bad []byte) (replacement []byte, skip int)
 }
 
 // Initialize a new Converter. If fromEncoding or toEncoding are not supported by
 // iconv then an EINVAL error will be returned. An ENOMEM error maybe returned if
 // there is not enough memory to initialize an iconv descriptor
 func NewConverter(fromEncoding string, toEncoding string) (converter *Converter, err error) {
+	return NewConverterWithOptions(fromEncoding, toEncoding, Options{})
+}
+
+// NewConverterWithOptions is like NewConverter but additionally accepts
+// Options controlling transliteration, lossy conversion, and Go-side
+// recovery from invalid input. Translit and Ignore are implemented by
+// appending the standard "//TRANSLIT" and "//IGNORE" modifiers to
+// toEncoding before opening the iconv descriptor
+func NewConverterWithOptions(fromEncoding string, toEncoding string, options Options) (converter *Converter, err error) {
 	converter = new(Converter)
+	converter.options = options
+
+	// apply any requested //TRANSLIT,IGNORE modifiers to the target encoding
+	var modifiers []string
+	if options.Translit {
+		modifiers = append(modifiers, "TRANSLIT")
+	}
+	if options.Ignore {
+		modifiers = append(modifiers, "IGNORE")
+	}
+	if len(modifiers) > 0 {
+		toEncoding = toEncoding + "//" + strings.Join(modifiers, ",")
+	}
 
 	// convert to C strings
 	toEncodingC := C.CString(toEncoding)
@@ -75,38 +127,109 @@ func (this *Converter) Close() (err error) {
 // For shift based output encodings, any end shift byte sequences can be generated by
 // passing a 0 length byte slice as input. Also passing a 0 length byte slice for output
 // will simply reset the iconv descriptor shift state without writing any bytes.
+//
+// If the Converter was created with an Options.OnInvalid handler, an EILSEQ is not
+// returned to the caller. Instead the handler is invoked with the offending bytes,
+// its replacement is spliced into output, and the conversion resumes past the
+// number of input bytes it asked to skip. The shift state is deliberately left
+// alone across a recovered byte - resetting it would emit a premature escape
+// sequence into the middle of a stateful encoding's output. If the replacement
+// doesn't fit in the remaining output, Convert returns E2BIG having already
+// consumed the offending input; the unwritten tail of the replacement is
+// queued and flushed at the start of the next Convert call, so OnInvalid is
+// never invoked twice for the same bytes
 func (this *Converter) Convert(input []byte, output []byte) (bytesRead int, bytesWritten int, err error) {
 	// make sure we are still open
-	if this.open {
-		inputLeft := C.size_t(len(input))
-		outputLeft := C.size_t(len(output))
-
-		if inputLeft > 0 && outputLeft > 0 {
-			// we have to give iconv a pointer to a pointer of the underlying
-			// storage of each byte slice - so far this is the simplest
-			// way i've found to do that in Go, but it seems ugly
-			inputPointer := (*C.char)(unsafe.Pointer(&input[0]))
-			outputPointer := (*C.char)(unsafe.Pointer(&output[0]))
-
-			_, err = C.call_iconv(this.context, inputPointer, &inputLeft, outputPointer, &outputLeft)
-
-			// update byte counters
-			bytesRead = len(input) - int(inputLeft)
-			bytesWritten = len(output) - int(outputLeft)
-		} else if inputLeft == 0 && outputLeft > 0 {
-			// inputPointer will be nil, outputPointer is generated as above
-			outputPointer := (*C.char)(unsafe.Pointer(&output[0]))
-
-			_, err = C.call_iconv(this.context, nil, &inputLeft, outputPointer, &outputLeft)
-
-			// update write byte counter
-			bytesWritten = len(output) - int(outputLeft)
-		} else {
-			// both input and output are zero length, do a shift state reset
-			_, err = C.call_iconv(this.context, nil, &inputLeft, nil, &outputLeft)
+	if !this.open {
+		return 0, 0, syscall.EBADF
+	}
+
+	// flush any replacement bytes that didn't fit in a previous call's
+	// output before looking at any new input
+	if len(this.pendingReplacement) > 0 {
+		n := copy(output, this.pendingReplacement)
+		bytesWritten += n
+		this.pendingReplacement = this.pendingReplacement[n:]
+
+		if len(this.pendingReplacement) > 0 {
+			return bytesRead, bytesWritten, syscall.E2BIG
 		}
+	}
+
+	for {
+		r, w, cErr := this.convertChunk(input[bytesRead:], output[bytesWritten:])
+		bytesRead += r
+		bytesWritten += w
+		err = cErr
+
+		// if the caller installed an OnInvalid handler, give it a chance to
+		// recover from an invalid sequence instead of aborting
+		if err == syscall.EILSEQ && this.options.OnInvalid != nil {
+			replacement, skip := this.options.OnInvalid(input[bytesRead:])
+			if skip <= 0 {
+				skip = 1
+			}
+
+			// the offending bytes are considered consumed as soon as
+			// OnInvalid has ruled on them, whether or not their full
+			// replacement fits in this call's output
+			bytesRead += skip
+
+			n := copy(output[bytesWritten:], replacement)
+			bytesWritten += n
+
+			if n < len(replacement) {
+				this.pendingReplacement = append([]byte(nil), replacement[n:]...)
+				err = syscall.E2BIG
+				break
+			}
+
+			if bytesRead >= len(input) {
+				err = nil
+				break
+			}
+
+			continue
+		}
+
+		break
+	}
+
+	return bytesRead, bytesWritten, err
+}
+
+// convertChunk performs a single underlying iconv call over input and
+// output, with no EILSEQ recovery. A 0 length input resets the shift state
+// (if output is also 0 length) or flushes any pending shift sequence (if
+// output is non-empty); a 0 length output, whatever the input, only resets
+// the shift state, reading and writing nothing
+func (this *Converter) convertChunk(input []byte, output []byte) (bytesRead int, bytesWritten int, err error) {
+	inputLeft := C.size_t(len(input))
+	outputLeft := C.size_t(len(output))
+
+	if inputLeft > 0 && outputLeft > 0 {
+		// we have to give iconv a pointer to a pointer of the underlying
+		// storage of each byte slice - so far this is the simplest
+		// way i've found to do that in Go, but it seems ugly
+		inputPointer := (*C.char)(unsafe.Pointer(&input[0]))
+		outputPointer := (*C.char)(unsafe.Pointer(&output[0]))
+
+		_, err = C.call_iconv(this.context, inputPointer, &inputLeft, outputPointer, &outputLeft)
+
+		// update byte counters
+		bytesRead = len(input) - int(inputLeft)
+		bytesWritten = len(output) - int(outputLeft)
+	} else if inputLeft == 0 && outputLeft > 0 {
+		// inputPointer will be nil, outputPointer is generated as above
+		outputPointer := (*C.char)(unsafe.Pointer(&output[0]))
+
+		_, err = C.call_iconv(this.context, nil, &inputLeft, outputPointer, &outputLeft)
+
+		// update write byte counter
+		bytesWritten = len(output) - int(outputLeft)
 	} else {
-		err = syscall.EBADF
+		// output is zero length, do a shift state reset without reading input
+		_, err = C.call_iconv(this.context, nil, &inputLeft, nil, &outputLeft)
 	}
 
 	return bytesRead, bytesWritten, err
@@ -117,11 +240,31 @@ func (this *Converter) Convert(input []byte, output []byte) (bytesRead int, byte
 // EILSEQ error may be returned if input contains invalid bytes for the
 // Converter's fromEncoding.
 func (this *Converter) ConvertString(input string) (output string, err error) {
+	output, _, err = this.ConvertStringInto(input, nil)
+	return output, err
+}
+
+// ConvertStringInto is like ConvertString, but lets the caller supply the
+// output buffer to convert into instead of always allocating a fresh one.
+// buf may be nil, in which case a buffer is allocated just like
+// ConvertString does. The buffer actually used (which may have been grown,
+// and so may not be buf) is returned alongside the output string so callers
+// can hang onto it and pass it back in on their next call, avoiding
+// allocation on high-throughput, many-short-strings workloads
+//
+// EILSEQ error may be returned if input contains invalid bytes for the
+// Converter's fromEncoding.
+func (this *Converter) ConvertStringInto(input string, buf []byte) (output string, outBuf []byte, err error) {
 	// make sure we are still open
 	if this.open {
 		// construct the buffers
 		inputBuffer := []byte(input)
-		outputBuffer := make([]byte, len(inputBuffer)*2) // we use a larger buffer to help avoid resizing later
+
+		outputBuffer := buf[:0]
+		if cap(outputBuffer) < len(inputBuffer)*2 {
+			outputBuffer = make([]byte, len(inputBuffer)*2) // we use a larger buffer to help avoid resizing later
+		}
+		outputBuffer = outputBuffer[:cap(outputBuffer)]
 
 		// call Convert until all input bytes are read or an error occurs
 		var bytesRead, totalBytesRead, bytesWritten, totalBytesWritten int
@@ -161,9 +304,10 @@ func (this *Converter) ConvertString(input string) (output string, err error) {
 
 		// construct the final output string
 		output = string(outputBuffer[:totalBytesWritten])
+		outBuf = outputBuffer
 	} else {
 		err = syscall.EBADF
 	}
 
-	return output, err
+	return output, outBuf, err
 }
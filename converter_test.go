@@ -0,0 +1,108 @@
+package iconv
+
+import "syscall"
+import "testing"
+
+func TestConvertOnInvalidRecovers(t *testing.T) {
+	var seen [][]byte
+
+	converter, err := NewConverterWithOptions("UTF-8", "UTF-8", Options{
+		OnInvalid: func(bad []byte) ([]byte, int) {
+			seen = append(seen, append([]byte(nil), bad...))
+			return []byte("?"), 1
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewConverterWithOptions() error = %v", err)
+	}
+	defer converter.Close()
+
+	out, err := converter.ConvertString("a\xffb")
+	if err != nil {
+		t.Fatalf("ConvertString() error = %v", err)
+	}
+
+	if out != "a?b" {
+		t.Errorf("ConvertString() = %q, want %q", out, "a?b")
+	}
+
+	if len(seen) != 1 || seen[0][0] != 0xff {
+		t.Errorf("OnInvalid called with %v, want exactly one call starting with 0xff", seen)
+	}
+}
+
+// TestConvertOnInvalidNotCalledTwiceAcrossE2BIG exercises the retry path
+// where a replacement doesn't fit in the caller's output buffer: the caller
+// must grow the buffer and call Convert again, and OnInvalid must not be
+// asked about the same offending byte a second time
+func TestConvertOnInvalidNotCalledTwiceAcrossE2BIG(t *testing.T) {
+	calls := 0
+
+	converter, err := NewConverterWithOptions("UTF-8", "UTF-8", Options{
+		OnInvalid: func(bad []byte) ([]byte, int) {
+			calls++
+			return []byte("REPLACEMENT"), 1
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewConverterWithOptions() error = %v", err)
+	}
+	defer converter.Close()
+
+	input := []byte("a\xffb")
+
+	small := make([]byte, 2)
+	bytesRead, bytesWritten, err := converter.Convert(input, small)
+	if err != syscall.E2BIG {
+		t.Fatalf("first Convert() error = %v, want E2BIG", err)
+	}
+
+	big := make([]byte, 64)
+	_, bytesWritten2, err := converter.Convert(input[bytesRead:], big)
+	if err != nil {
+		t.Fatalf("second Convert() error = %v", err)
+	}
+
+	if calls != 1 {
+		t.Errorf("OnInvalid called %d times across the E2BIG retry, want 1", calls)
+	}
+
+	got := string(small[:bytesWritten]) + string(big[:bytesWritten2])
+	if want := "aREPLACEMENTb"; got != want {
+		t.Errorf("converted output = %q, want %q", got, want)
+	}
+}
+
+func TestConvertWithTranslitApproximatesUnsupportedChars(t *testing.T) {
+	converter, err := NewConverterWithOptions("UTF-8", "ASCII", Options{Translit: true})
+	if err != nil {
+		t.Fatalf("NewConverterWithOptions() error = %v", err)
+	}
+	defer converter.Close()
+
+	out, err := converter.ConvertString("café")
+	if err != nil {
+		t.Fatalf("ConvertString() error = %v", err)
+	}
+
+	if len(out) == 0 {
+		t.Errorf("ConvertString() = %q, want a non-empty ASCII transliteration", out)
+	}
+}
+
+func TestConvertWithIgnoreDropsUnsupportedChars(t *testing.T) {
+	converter, err := NewConverterWithOptions("UTF-8", "ASCII", Options{Ignore: true})
+	if err != nil {
+		t.Fatalf("NewConverterWithOptions() error = %v", err)
+	}
+	defer converter.Close()
+
+	out, err := converter.ConvertString("abc世def")
+	if err != nil {
+		t.Fatalf("ConvertString() error = %v", err)
+	}
+
+	if out != "abcdef" {
+		t.Errorf("ConvertString() = %q, want %q", out, "abcdef")
+	}
+}
@@ -0,0 +1,313 @@
+package iconv
+
+import "bytes"
+import "syscall"
+import "unicode/utf8"
+
+// byteOrderMark pairs a BOM prefix with the encoding it signals. Entries are
+// checked in order, so longer prefixes that share a shorter prefix with
+// another entry (UTF-32LE vs UTF-16LE) must come first
+var byteOrderMarks = []struct {
+	prefix   []byte
+	encoding string
+}{
+	{[]byte{0x00, 0x00, 0xFE, 0xFF}, "UTF-32BE"},
+	{[]byte{0xFF, 0xFE, 0x00, 0x00}, "UTF-32LE"},
+	{[]byte{0xFE, 0xFF}, "UTF-16BE"},
+	{[]byte{0xFF, 0xFE}, "UTF-16LE"},
+	{[]byte{0xEF, 0xBB, 0xBF}, "UTF-8"},
+}
+
+// encodingCandidates are scored by byte-frequency/structure heuristics when
+// a sample has neither a BOM nor is valid UTF-8. Order only matters as a
+// tie-break between equally scored candidates
+var encodingCandidates = []struct {
+	name  string
+	score func(sample []byte) float64
+}{
+	{"Shift_JIS", func(s []byte) float64 { return scoreMultiByte(s, shiftJISSequence) }},
+	{"GB18030", func(s []byte) float64 { return scoreMultiByte(s, gb18030Sequence) }},
+	{"EUC-KR", func(s []byte) float64 { return scoreMultiByte(s, eucKRSequence) }},
+	{"Windows-1252", scoreWindows1252},
+	{"Windows-1251", scoreWindows1251},
+	{"ISO-8859-1", scoreISO88591},
+	{"ISO-8859-15", scoreISO885915},
+}
+
+// DetectEncoding guesses the character encoding of sample
+//
+// It first looks for a UTF-8/UTF-16/UTF-32 byte order mark, returning it
+// with full confidence and the number of leading bytes the caller should
+// discard as consumed. Failing that, it checks whether sample is valid
+// UTF-8 outright. Failing that, it scores sample against a handful of
+// common single and multi byte encodings using precomputed byte-frequency
+// and sequence-structure heuristics and returns the best match. If nothing
+// scores above 0, encoding is returned empty
+func DetectEncoding(sample []byte) (encoding string, confidence float64, consumed int) {
+	for _, bom := range byteOrderMarks {
+		if bytes.HasPrefix(sample, bom.prefix) {
+			return bom.encoding, 1.0, len(bom.prefix)
+		}
+	}
+
+	if utf8.Valid(sample) {
+		switch {
+		case len(sample) == 0:
+			return "UTF-8", 1.0, 0
+		case hasHighBytes(sample):
+			// decoded cleanly as UTF-8 despite using multibyte sequences,
+			// very unlikely to be a coincidence
+			return "UTF-8", 0.99, 0
+		default:
+			// pure ASCII, technically valid under nearly every encoding,
+			// but UTF-8 is the right default
+			return "UTF-8", 0.9, 0
+		}
+	}
+
+	bestEncoding := ""
+	bestScore := 0.0
+
+	for _, candidate := range encodingCandidates {
+		if s := candidate.score(sample); s > bestScore {
+			bestScore = s
+			bestEncoding = candidate.name
+		}
+	}
+
+	return bestEncoding, bestScore, 0
+}
+
+// ConvertAutoToUTF8 runs DetectEncoding against input and, unless it is
+// already UTF-8, converts it to UTF-8 using the detected encoding. The BOM,
+// if any, is stripped from both the returned bytes and the conversion input
+func ConvertAutoToUTF8(input []byte) (output []byte, encoding string, err error) {
+	encoding, _, consumed := DetectEncoding(input)
+	if encoding == "" {
+		return nil, "", syscall.EINVAL
+	}
+
+	sample := input[consumed:]
+
+	if encoding == "UTF-8" {
+		return sample, encoding, nil
+	}
+
+	converter, err := NewConverter(encoding, "UTF-8")
+	if err != nil {
+		return nil, encoding, err
+	}
+	defer converter.Close()
+
+	output, err = convertAll(converter, sample)
+
+	return output, encoding, err
+}
+
+func hasHighBytes(sample []byte) bool {
+	for _, b := range sample {
+		if b >= 0x80 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scoreSingleByte scores a sample against a single byte encoding by
+// averaging a per-byte weight (1.0 = typical, 0.0 = never seen) over just
+// the high bytes, since low bytes are shared with ASCII and uninformative.
+// unassigned marks byte values that encoding leaves undefined entirely
+func scoreSingleByte(sample []byte, unassigned map[byte]bool, weight func(b byte) float64) float64 {
+	highBytes := 0
+	var total float64
+
+	for _, b := range sample {
+		if b < 0x80 {
+			continue
+		}
+
+		highBytes++
+
+		if unassigned[b] {
+			continue
+		}
+
+		total += weight(b)
+	}
+
+	if highBytes == 0 {
+		return 0
+	}
+
+	return total / float64(highBytes)
+}
+
+func scoreWindows1252(sample []byte) float64 {
+	unassigned := map[byte]bool{0x81: true, 0x8D: true, 0x8F: true, 0x90: true, 0x9D: true}
+
+	return scoreSingleByte(sample, unassigned, func(b byte) float64 {
+		switch {
+		case b >= 0xC0:
+			return 1.0 // accented Latin letters
+		case b >= 0x91 && b <= 0x97:
+			return 0.6 // curly quotes and dashes
+		case b >= 0x80 && b <= 0x9F:
+			return 0.4 // remaining punctuation/currency extensions
+		default:
+			return 0.3
+		}
+	})
+}
+
+func scoreWindows1251(sample []byte) float64 {
+	unassigned := map[byte]bool{0x98: true}
+
+	return scoreSingleByte(sample, unassigned, func(b byte) float64 {
+		switch {
+		case b >= 0xC0:
+			return 1.0 // main Cyrillic letter block
+		case b == 0xA8 || b == 0xB8 || b == 0xAA || b == 0xBA || b == 0xAF || b == 0xBF:
+			return 0.9 // Ё/ё and other precomposed Cyrillic letters
+		case b >= 0x80 && b <= 0x9F:
+			return 0.4 // punctuation/currency extensions
+		default:
+			return 0.3
+		}
+	})
+}
+
+func scoreISO88591(sample []byte) float64 {
+	return scoreSingleByte(sample, nil, func(b byte) float64 {
+		switch {
+		case b >= 0xC0:
+			return 1.0 // accented Latin letters
+		case b >= 0xA0:
+			return 0.8 // Latin-1 supplement punctuation/symbols
+		default:
+			return 0.1 // C1 control codes, rare in real text
+		}
+	})
+}
+
+func scoreISO885915(sample []byte) float64 {
+	return scoreSingleByte(sample, nil, func(b byte) float64 {
+		switch {
+		case b >= 0xC0:
+			return 1.0 // accented Latin letters
+		case b == 0xA4:
+			return 0.9 // Euro sign, the headline difference from Latin-1
+		case b >= 0xA0:
+			return 0.75
+		default:
+			return 0.1 // C1 control codes, rare in real text
+		}
+	})
+}
+
+// scoreMultiByte scores a sample against a multibyte encoding the same way
+// scoreSingleByte does: plain ASCII bytes are shared with every encoding and
+// carry no information, so they're excluded from both the numerator and the
+// denominator and only the high-byte-anchored sequences are judged. A high
+// byte that doesn't start a well-formed sequence is skipped one at a time
+// so a single corrupt character doesn't disqualify the rest of the sample
+func scoreMultiByte(sample []byte, isSequence func(b []byte) (consumed int, ok bool)) float64 {
+	examined := 0
+	valid := 0
+
+	for i := 0; i < len(sample); {
+		if sample[i] < 0x80 {
+			i++
+			continue
+		}
+
+		if n, ok := isSequence(sample[i:]); ok {
+			examined += n
+			valid += n
+			i += n
+		} else {
+			examined++
+			i++
+		}
+	}
+
+	if examined == 0 {
+		return 0
+	}
+
+	return float64(valid) / float64(examined)
+}
+
+// shiftJISSequence recognizes a single ASCII byte, a halfwidth katakana
+// byte, or a lead/trail byte pair per the Shift_JIS structure
+func shiftJISSequence(b []byte) (consumed int, ok bool) {
+	c := b[0]
+
+	switch {
+	case c < 0x80:
+		return 1, true
+	case c >= 0xA1 && c <= 0xDF:
+		return 1, true
+	case (c >= 0x81 && c <= 0x9F) || (c >= 0xE0 && c <= 0xFC):
+		if len(b) < 2 {
+			return 0, false
+		}
+
+		t := b[1]
+		if (t >= 0x40 && t <= 0x7E) || (t >= 0x80 && t <= 0xFC) {
+			return 2, true
+		}
+	}
+
+	return 0, false
+}
+
+// eucKRSequence recognizes a single ASCII byte or a lead/trail byte pair
+// per the EUC-KR structure
+func eucKRSequence(b []byte) (consumed int, ok bool) {
+	c := b[0]
+
+	if c < 0x80 {
+		return 1, true
+	}
+
+	if c >= 0xA1 && c <= 0xFE && len(b) >= 2 {
+		t := b[1]
+		if t >= 0xA1 && t <= 0xFE {
+			return 2, true
+		}
+	}
+
+	return 0, false
+}
+
+// gb18030Sequence recognizes a single ASCII byte, a GBK-style 2 byte
+// sequence, or a GB18030 4 byte extension sequence
+func gb18030Sequence(b []byte) (consumed int, ok bool) {
+	c := b[0]
+
+	if c < 0x80 {
+		return 1, true
+	}
+
+	if c == 0x80 || c == 0xFF || len(b) < 2 {
+		return 0, false
+	}
+
+	t := b[1]
+	switch {
+	case t >= 0x40 && t <= 0xFE && t != 0x7F:
+		return 2, true
+	case t >= 0x30 && t <= 0x39:
+		if len(b) < 4 {
+			return 0, false
+		}
+
+		b3, b4 := b[2], b[3]
+		if b3 >= 0x81 && b3 <= 0xFE && b4 >= 0x30 && b4 <= 0x39 {
+			return 4, true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,47 @@
+package iconv
+
+import "testing"
+
+func TestDetectEncodingBOM(t *testing.T) {
+	cases := []struct {
+		name     string
+		sample   []byte
+		encoding string
+		consumed int
+	}{
+		{"utf8", []byte{0xEF, 0xBB, 0xBF, 'h', 'i'}, "UTF-8", 3},
+		{"utf16le", []byte{0xFF, 0xFE, 'h', 0x00}, "UTF-16LE", 2},
+		{"utf16be", []byte{0xFE, 0xFF, 0x00, 'h'}, "UTF-16BE", 2},
+		{"utf32le", []byte{0xFF, 0xFE, 0x00, 0x00, 'h', 0x00, 0x00, 0x00}, "UTF-32LE", 4},
+		{"utf32be", []byte{0x00, 0x00, 0xFE, 0xFF, 0x00, 0x00, 0x00, 'h'}, "UTF-32BE", 4},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			encoding, confidence, consumed := DetectEncoding(c.sample)
+			if encoding != c.encoding || consumed != c.consumed {
+				t.Errorf("DetectEncoding() = %q, %v, %d, want %q, _, %d", encoding, confidence, consumed, c.encoding, c.consumed)
+			}
+		})
+	}
+}
+
+// TestDetectEncodingSparseHighByte guards against scoring ASCII bytes as
+// "valid" evidence for the multibyte candidates: an English paragraph with
+// one stray Windows-1252 curly-quote byte should be identified as
+// Windows-1252, not misread as a CJK encoding just because it's mostly ASCII
+func TestDetectEncodingSparseHighByte(t *testing.T) {
+	// note the curly quote bytes are surrounded by spaces - spaces don't
+	// fall in any CJK trail-byte range, so this isolates the high bytes as
+	// unambiguous Windows-1252 punctuation rather than accidental lead/trail
+	// pairs with neighboring ASCII letters
+	sample := append([]byte("He said "), 0x93)
+	sample = append(sample, []byte(" hello ")...)
+	sample = append(sample, 0x94)
+	sample = append(sample, []byte(" and then left the room for the rest of the afternoon.")...)
+
+	encoding, _, _ := DetectEncoding(sample)
+	if encoding != "Windows-1252" {
+		t.Errorf("DetectEncoding() = %q, want Windows-1252", encoding)
+	}
+}
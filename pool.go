@@ -0,0 +1,68 @@
+package iconv
+
+import "syscall"
+
+// Pool maintains a bounded set of ready-to-use Converters for a single
+// (fromEncoding, toEncoding) pair, so repeated short-lived conversions don't
+// each pay for an iconv_open/iconv_close round trip
+type Pool struct {
+	fromEncoding string
+	toEncoding   string
+	idle         chan *Converter
+}
+
+// NewPool creates a Pool for fromEncoding/toEncoding that holds onto at most
+// max idle Converters. max must be at least 1; an EINVAL error is returned
+// otherwise, since a Pool that can never hold an idle Converter isn't a
+// usable pool. A Converter is opened immediately to verify fromEncoding and
+// toEncoding are supported by iconv
+func NewPool(fromEncoding string, toEncoding string, max int) (pool *Pool, err error) {
+	if max < 1 {
+		return nil, syscall.EINVAL
+	}
+
+	converter, err := NewConverter(fromEncoding, toEncoding)
+	if err != nil {
+		return nil, err
+	}
+
+	pool = &Pool{
+		fromEncoding: fromEncoding,
+		toEncoding:   toEncoding,
+		idle:         make(chan *Converter, max),
+	}
+
+	pool.idle <- converter
+
+	return pool, nil
+}
+
+// Get returns an idle Converter from the Pool if one is available, or
+// opens a new one otherwise
+func (this *Pool) Get() (*Converter, error) {
+	select {
+	case converter := <-this.idle:
+		return converter, nil
+	default:
+		return NewConverter(this.fromEncoding, this.toEncoding)
+	}
+}
+
+// Put returns a Converter to the Pool so a future Get can reuse it. Its
+// shift state is reset first so the next caller starts clean. If the Pool
+// is already holding max idle Converters, converter is closed instead of
+// being retained
+func (this *Pool) Put(converter *Converter) {
+	if converter == nil || !converter.open {
+		return
+	}
+
+	// reset the shift state between reuses
+	converter.Convert(nil, nil)
+
+	select {
+	case this.idle <- converter:
+	default:
+		converter.Close()
+	}
+}
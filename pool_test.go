@@ -0,0 +1,35 @@
+package iconv
+
+import "syscall"
+import "testing"
+
+func TestNewPoolRejectsNonPositiveMax(t *testing.T) {
+	for _, max := range []int{0, -1} {
+		if _, err := NewPool("UTF-8", "UTF-8", max); err != syscall.EINVAL {
+			t.Errorf("NewPool(max=%d) = _, %v, want %v", max, err, syscall.EINVAL)
+		}
+	}
+}
+
+func TestPoolGetPutReusesConverter(t *testing.T) {
+	pool, err := NewPool("UTF-8", "UTF-8", 1)
+	if err != nil {
+		t.Fatalf("NewPool() error = %v", err)
+	}
+
+	first, err := pool.Get()
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	pool.Put(first)
+
+	second, err := pool.Get()
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	if second != first {
+		t.Errorf("Get() after Put() returned a different Converter, want the same one back")
+	}
+}
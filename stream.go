@@ -0,0 +1,246 @@
+package iconv
+
+import (
+	"io"
+	"syscall"
+)
+
+// default size of the chunk read from the underlying io.Reader / flushed to
+// the underlying io.Writer on each pass
+const streamBufferSize = 4096
+
+// maxConsecutiveEmptyReads bounds how many times in a row Reader.Read will
+// tolerate the underlying io.Reader legally returning (0, nil) before giving
+// up, mirroring the same safeguard in io.Copy
+const maxConsecutiveEmptyReads = 100
+
+// Reader wraps an io.Reader, converting bytes read from it from one
+// encoding to another via a Converter
+type Reader struct {
+	source     io.Reader
+	converter  *Converter
+	raw        []byte // unconverted bytes carried over between reads
+	rawBuf     []byte // scratch buffer used to pull from source
+	out        []byte // converted bytes not yet returned to the caller
+	eof        bool   // source has been fully drained
+	done       bool   // final shift state reset has been emitted
+	emptyReads int    // consecutive reads of source that returned (0, nil)
+}
+
+// NewReader creates a Reader that converts everything read from r out of
+// fromEncoding and into toEncoding. The returned Reader must be closed to
+// release the underlying Converter
+func NewReader(r io.Reader, fromEncoding string, toEncoding string) (io.ReadCloser, error) {
+	converter, err := NewConverter(fromEncoding, toEncoding)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reader{
+		source:    r,
+		converter: converter,
+		rawBuf:    make([]byte, streamBufferSize),
+	}, nil
+}
+
+// Read converts and returns as much data as is available, pulling more from
+// the underlying io.Reader as needed
+//
+// If a read ends in the middle of a multibyte sequence, the unconsumed tail
+// is kept and prepended to data pulled in by the next call rather than being
+// reported as an error
+func (this *Reader) Read(p []byte) (n int, err error) {
+	for len(this.out) == 0 {
+		if this.done {
+			return 0, io.EOF
+		}
+
+		if this.eof && len(this.raw) == 0 {
+			// nothing left to read, emit the final shift state reset
+			outBuf := make([]byte, streamBufferSize)
+			_, bytesWritten, cErr := this.converter.Convert([]byte{}, outBuf)
+			if cErr != nil {
+				return 0, cErr
+			}
+
+			this.out = outBuf[:bytesWritten]
+			this.done = true
+			continue
+		}
+
+		if !this.eof {
+			nRead, rErr := this.source.Read(this.rawBuf)
+			if nRead > 0 {
+				this.raw = append(this.raw, this.rawBuf[:nRead]...)
+				this.emptyReads = 0
+			}
+
+			if rErr != nil {
+				if rErr == io.EOF {
+					this.eof = true
+				} else {
+					return 0, rErr
+				}
+			}
+
+			if nRead == 0 && !this.eof {
+				// legal per the io.Reader contract, but an io.Reader that
+				// does this forever would otherwise spin us in a tight loop
+				this.emptyReads++
+				if this.emptyReads > maxConsecutiveEmptyReads {
+					return 0, io.ErrNoProgress
+				}
+
+				continue
+			}
+		}
+
+		if len(this.raw) == 0 {
+			continue
+		}
+
+		outBuf := make([]byte, len(this.raw)*2+streamBufferSize)
+		bytesRead, bytesWritten, cErr := this.converter.Convert(this.raw, outBuf)
+
+		if cErr == syscall.EINVAL && !this.eof {
+			// trailing bytes are an incomplete multibyte sequence, keep them
+			// and wait for more input before trying again
+			this.raw = this.raw[bytesRead:]
+			this.out = append(this.out, outBuf[:bytesWritten]...)
+			continue
+		} else if cErr == syscall.E2BIG {
+			// outBuf was sized generously above, but handle it the same way
+			// ConvertString does just in case
+			this.raw = this.raw[bytesRead:]
+			this.out = append(this.out, outBuf[:bytesWritten]...)
+			continue
+		} else if cErr != nil {
+			return 0, cErr
+		}
+
+		this.raw = this.raw[bytesRead:]
+		this.out = append(this.out, outBuf[:bytesWritten]...)
+	}
+
+	n = copy(p, this.out)
+	this.out = this.out[n:]
+
+	return n, nil
+}
+
+// Close releases the Reader's underlying Converter. It does not close the
+// wrapped io.Reader
+func (this *Reader) Close() error {
+	return this.converter.Close()
+}
+
+// Writer wraps an io.Writer, converting bytes written to it from one
+// encoding to another via a Converter before passing them on
+type Writer struct {
+	sink      io.Writer
+	converter *Converter
+	tail      []byte // incomplete multibyte sequence carried over from a previous Write
+	closed    bool
+}
+
+// NewWriter creates a Writer that converts everything written to it out of
+// fromEncoding and into toEncoding before writing the result to w. Close
+// must be called to flush the final shift state reset and release the
+// underlying Converter
+func NewWriter(w io.Writer, fromEncoding string, toEncoding string) (io.WriteCloser, error) {
+	converter, err := NewConverter(fromEncoding, toEncoding)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		sink:      w,
+		converter: converter,
+	}, nil
+}
+
+// Write converts p and writes the result to the underlying io.Writer
+//
+// If p ends in the middle of a multibyte sequence, the unconsumed tail is
+// buffered and prepended to the next call to Write instead of being
+// reported as an error
+func (this *Writer) Write(p []byte) (n int, err error) {
+	if this.closed {
+		return 0, syscall.EBADF
+	}
+
+	input := p
+	if len(this.tail) > 0 {
+		input = append(this.tail, p...)
+		this.tail = nil
+	}
+
+	outBuf := make([]byte, len(input)*2+streamBufferSize)
+	var totalRead, totalWritten int
+
+	for totalRead < len(input) {
+		bytesRead, bytesWritten, cErr := this.converter.Convert(input[totalRead:], outBuf[totalWritten:])
+		totalRead += bytesRead
+		totalWritten += bytesWritten
+
+		if cErr == syscall.E2BIG {
+			tempBuffer := make([]byte, len(outBuf)+len(input))
+			copy(tempBuffer, outBuf)
+			outBuf = tempBuffer
+			continue
+		} else if cErr == syscall.EINVAL {
+			// the remaining bytes are an incomplete multibyte sequence,
+			// carry them over to the next Write
+			this.tail = append(this.tail, input[totalRead:]...)
+			totalRead = len(input)
+		} else if cErr != nil {
+			return 0, cErr
+		}
+	}
+
+	if totalWritten > 0 {
+		if _, wErr := this.sink.Write(outBuf[:totalWritten]); wErr != nil {
+			return 0, wErr
+		}
+	}
+
+	return len(p), nil
+}
+
+// Close flushes the final shift state reset to the underlying io.Writer and
+// releases the Writer's underlying Converter. It does not close the
+// wrapped io.Writer
+func (this *Writer) Close() (err error) {
+	if this.closed {
+		return nil
+	}
+	this.closed = true
+
+	// however Close returns below, the Converter's iconv_t must not leak;
+	// only surface the close error itself if nothing else already failed
+	defer func() {
+		closeErr := this.converter.Close()
+		this.converter.open = false
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	if len(this.tail) > 0 {
+		return syscall.EINVAL
+	}
+
+	outBuf := make([]byte, streamBufferSize)
+	_, bytesWritten, cErr := this.converter.Convert([]byte{}, outBuf)
+	if cErr != nil {
+		return cErr
+	}
+
+	if bytesWritten > 0 {
+		if _, wErr := this.sink.Write(outBuf[:bytesWritten]); wErr != nil {
+			return wErr
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package iconv
+
+import "bytes"
+import "io"
+import "strings"
+import "syscall"
+import "testing"
+import "testing/iotest"
+
+func TestReaderConvertsStreamed(t *testing.T) {
+	input := "héllo wörld"
+
+	r, err := NewReader(strings.NewReader(input), "UTF-8", "ISO-8859-1")
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	defer r.Close()
+
+	converted, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	back, err := NewConverter("ISO-8859-1", "UTF-8")
+	if err != nil {
+		t.Fatalf("NewConverter() error = %v", err)
+	}
+	defer back.Close()
+
+	roundTripped, err := back.ConvertString(string(converted))
+	if err != nil {
+		t.Fatalf("ConvertString() error = %v", err)
+	}
+
+	if roundTripped != input {
+		t.Errorf("round trip through Reader = %q, want %q", roundTripped, input)
+	}
+}
+
+// TestReaderHandlesPartialMultibyteAcrossReads feeds the underlying
+// io.Reader one byte at a time so every multibyte UTF-16LE code unit is
+// split across two Read calls, exercising the EINVAL tail-carryover path
+func TestReaderHandlesPartialMultibyteAcrossReads(t *testing.T) {
+	toUTF16, err := NewConverter("UTF-8", "UTF-16LE")
+	if err != nil {
+		t.Fatalf("NewConverter() error = %v", err)
+	}
+	defer toUTF16.Close()
+
+	input := "héllo"
+
+	encoded, err := toUTF16.ConvertString(input)
+	if err != nil {
+		t.Fatalf("ConvertString() error = %v", err)
+	}
+
+	r, err := NewReader(iotest.OneByteReader(strings.NewReader(encoded)), "UTF-16LE", "UTF-8")
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	defer r.Close()
+
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	if string(out) != input {
+		t.Errorf("Read() = %q, want %q", string(out), input)
+	}
+}
+
+func TestWriterConvertsAndFlushesOnClose(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, err := NewWriter(&buf, "UTF-8", "ISO-8859-1")
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+
+	input := "héllo wörld"
+	if _, err := io.WriteString(w, input); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	back, err := NewConverter("ISO-8859-1", "UTF-8")
+	if err != nil {
+		t.Fatalf("NewConverter() error = %v", err)
+	}
+	defer back.Close()
+
+	roundTripped, err := back.ConvertString(buf.String())
+	if err != nil {
+		t.Fatalf("ConvertString() error = %v", err)
+	}
+
+	if roundTripped != input {
+		t.Errorf("round trip through Writer = %q, want %q", roundTripped, input)
+	}
+}
+
+func TestWriterCloseIsIdempotent(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, err := NewWriter(&buf, "UTF-8", "UTF-8")
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("first Close() error = %v", err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Errorf("second Close() error = %v, want nil", err)
+	}
+}
+
+// TestWriterCloseClosesConverterOnEveryPath guards against leaking the
+// underlying iconv_t on the early-return paths of Close, not just the
+// happy path
+func TestWriterCloseClosesConverterOnEveryPath(t *testing.T) {
+	var buf bytes.Buffer
+
+	wc, err := NewWriter(&buf, "UTF-16LE", "UTF-8")
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	w := wc.(*Writer)
+
+	// a single byte is an incomplete UTF-16LE code unit, so Write buffers
+	// it as a tail instead of converting it
+	if _, err := w.Write([]byte{0x68}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	if err := w.Close(); err != syscall.EINVAL {
+		t.Fatalf("Close() error = %v, want EINVAL", err)
+	}
+
+	if w.converter.open {
+		t.Errorf("Close() left the Converter open on the incomplete-tail path")
+	}
+}
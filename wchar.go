@@ -0,0 +1,116 @@
+package iconv
+
+/*
+#include <wchar.h>
+*/
+import "C"
+import "syscall"
+import "unsafe"
+
+// size in bytes of the platform's wchar_t: 2 on Windows, 4 on Linux/macOS
+const wcharSize = int(unsafe.Sizeof(C.wchar_t(0)))
+
+// WcharString is a portable, platform-independent representation of a
+// wchar_t* buffer - one int32 per wide character regardless of whether the
+// platform's native wchar_t is 2 or 4 bytes wide
+type WcharString []int32
+
+// ConvertToWchar converts a string out of fromEncoding into a WcharString,
+// going through iconv's "wchar_t" pseudo-encoding. iconv's output is read as
+// native C.wchar_t values, sized and byte ordered for the current platform,
+// and unpacked into a WcharString holding one int32 per wchar_t value
+func ConvertToWchar(s string, fromEncoding string) (WcharString, error) {
+	converter, err := NewConverter(fromEncoding, "wchar_t")
+	if err != nil {
+		return nil, err
+	}
+	defer converter.Close()
+
+	output, err := convertAll(converter, []byte(s))
+	if err != nil {
+		return nil, err
+	}
+
+	return bytesToWchar(output), nil
+}
+
+// ConvertFromWchar converts a WcharString into a string in toEncoding,
+// going through iconv's "wchar_t" pseudo-encoding
+func ConvertFromWchar(ws WcharString, toEncoding string) (string, error) {
+	converter, err := NewConverter("wchar_t", toEncoding)
+	if err != nil {
+		return "", err
+	}
+	defer converter.Close()
+
+	output, err := convertAll(converter, wcharToBytes(ws))
+	if err != nil {
+		return "", err
+	}
+
+	return string(output), nil
+}
+
+// convertAll runs input through converter until every byte has been
+// consumed, growing the output buffer on E2BIG the same way ConvertString
+// does, and finishes with a shift state reset
+func convertAll(converter *Converter, input []byte) (output []byte, err error) {
+	outputBuffer := make([]byte, len(input)*2+wcharSize)
+
+	var bytesRead, totalBytesRead, bytesWritten, totalBytesWritten int
+
+	for totalBytesRead < len(input) && err == nil {
+		bytesRead, bytesWritten, err = converter.Convert(input[totalBytesRead:], outputBuffer[totalBytesWritten:])
+
+		totalBytesRead += bytesRead
+		totalBytesWritten += bytesWritten
+
+		if err == syscall.E2BIG {
+			tempBuffer := make([]byte, len(outputBuffer)+len(input))
+			copy(tempBuffer, outputBuffer)
+			outputBuffer = tempBuffer
+			err = nil
+		}
+	}
+
+	if err == nil {
+		_, bytesWritten, err = converter.Convert([]byte{}, outputBuffer[totalBytesWritten:])
+		totalBytesWritten += bytesWritten
+	}
+
+	return outputBuffer[:totalBytesWritten], err
+}
+
+// bytesToWchar reinterprets a buffer of native C.wchar_t values, as produced
+// by iconv, into a platform-independent WcharString
+func bytesToWchar(b []byte) WcharString {
+	count := len(b) / wcharSize
+	if count == 0 {
+		return WcharString{}
+	}
+
+	wchars := (*[1 << 28]C.wchar_t)(unsafe.Pointer(&b[0]))[:count:count]
+
+	result := make(WcharString, count)
+	for i, w := range wchars {
+		result[i] = int32(w)
+	}
+
+	return result
+}
+
+// wcharToBytes packs a WcharString into a buffer of native C.wchar_t
+// values, ready to be fed to iconv as "wchar_t" input
+func wcharToBytes(ws WcharString) []byte {
+	if len(ws) == 0 {
+		return []byte{}
+	}
+
+	wchars := make([]C.wchar_t, len(ws))
+	for i, w := range ws {
+		wchars[i] = C.wchar_t(w)
+	}
+
+	size := len(wchars) * wcharSize
+	return (*[1 << 28]byte)(unsafe.Pointer(&wchars[0]))[:size:size]
+}
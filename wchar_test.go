@@ -0,0 +1,70 @@
+package iconv
+
+import "testing"
+
+func TestWcharRoundTrip(t *testing.T) {
+	input := "héllo, 世界"
+
+	ws, err := ConvertToWchar(input, "UTF-8")
+	if err != nil {
+		t.Fatalf("ConvertToWchar() error = %v", err)
+	}
+
+	if len(ws) == 0 {
+		t.Fatalf("ConvertToWchar() returned an empty WcharString")
+	}
+
+	back, err := ConvertFromWchar(ws, "UTF-8")
+	if err != nil {
+		t.Fatalf("ConvertFromWchar() error = %v", err)
+	}
+
+	if back != input {
+		t.Errorf("round trip through WcharString = %q, want %q", back, input)
+	}
+}
+
+func TestConvertToWcharASCIILength(t *testing.T) {
+	ws, err := ConvertToWchar("abc", "UTF-8")
+	if err != nil {
+		t.Fatalf("ConvertToWchar() error = %v", err)
+	}
+
+	if len(ws) != 3 {
+		t.Errorf("len(ConvertToWchar(\"abc\")) = %d, want 3", len(ws))
+	}
+}
+
+// TestWcharBytePacking exercises the unsafe packing/unpacking helpers
+// directly against a native C.wchar_t buffer, independent of iconv
+func TestWcharBytePacking(t *testing.T) {
+	ws := WcharString{'a', 'b', 0x4e16} // 'a', 'b', 世
+
+	packed := wcharToBytes(ws)
+	if len(packed) != len(ws)*wcharSize {
+		t.Fatalf("wcharToBytes() returned %d bytes, want %d", len(packed), len(ws)*wcharSize)
+	}
+
+	unpacked := bytesToWchar(packed)
+	if len(unpacked) != len(ws) {
+		t.Fatalf("bytesToWchar() returned %d elements, want %d", len(unpacked), len(ws))
+	}
+
+	for i := range ws {
+		if unpacked[i] != ws[i] {
+			t.Errorf("unpacked[%d] = %#x, want %#x", i, unpacked[i], ws[i])
+		}
+	}
+}
+
+func TestBytesToWcharEmpty(t *testing.T) {
+	if ws := bytesToWchar(nil); len(ws) != 0 {
+		t.Errorf("bytesToWchar(nil) = %v, want empty", ws)
+	}
+}
+
+func TestWcharToBytesEmpty(t *testing.T) {
+	if b := wcharToBytes(nil); len(b) != 0 {
+		t.Errorf("wcharToBytes(nil) = %v, want empty", b)
+	}
+}